@@ -0,0 +1,90 @@
+// Package bloomfilter is face-meltingly fast, thread-safe,
+// marshalable, unionable, probability- and
+// optimal-size-calculating Bloom filter in go
+//
+// https://github.com/steakknife/bloomfilter
+//
+// Copyright © 2014, 2015, 2018 Barry Allard
+//
+// MIT license
+//
+package bloomfilter
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+	"io"
+)
+
+// hashingWriter writes to a Writer while simultaneously hashing the bytes
+// written, the write-side mirror of hashingReader.
+type hashingWriter struct {
+	writer io.Writer
+	hasher hash.Hash
+	tot    int64
+}
+
+func (h *hashingWriter) Write(p []byte) (n int, err error) {
+	n, err = h.writer.Write(p)
+	h.tot += int64(n)
+	if err != nil {
+		return n, err
+	}
+	h.hasher.Write(p[:n])
+	return n, err
+}
+
+// marshalBinaryHeader writes the wire header read back by
+// unmarshalBinaryHeader. In classic mode this is exactly the legacy
+// three-field [k][n][m] layout, so pre-existing classic files are
+// unaffected. Double-hash mode is flagged by setting doubleHashFlag (the
+// k field's top bit) rather than adding a byte to the layout: a real k
+// never comes close to 1<<63, so a legacy classic header can never be
+// mistaken for a flagged one.
+func marshalBinaryHeader(w io.Writer, mode hashMode, storedKeysOrDhK, n, m uint64) error {
+	kField := storedKeysOrDhK
+	if mode == modeDoubleHash {
+		kField |= doubleHashFlag
+	}
+	if err := binary.Write(w, binary.LittleEndian, kField); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, n); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, m)
+}
+
+// MarshallToWriter writes f's binary wire format (header, keys, bits,
+// sha384 trailer) to w. This is the write-side counterpart of
+// unmarshalBinaryHeader/UnmarshalFromReader; WriteTo wraps it in a gzip
+// stream.
+func (f *Filter) MarshallToWriter(w io.Writer) (n int64, m uint64, err error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	buf := &hashingWriter{writer: w, hasher: sha512.New384()}
+
+	kField := uint64(len(f.keys))
+	if f.mode == modeDoubleHash {
+		kField = f.k
+	}
+	if err = marshalBinaryHeader(buf, f.mode, kField, f.n, f.m); err != nil {
+		return buf.tot, f.m, err
+	}
+	if err = binary.Write(buf, binary.LittleEndian, f.keys); err != nil {
+		return buf.tot, f.m, err
+	}
+	if err = binary.Write(buf, binary.LittleEndian, f.bits); err != nil {
+		return buf.tot, f.m, err
+	}
+
+	sum := buf.hasher.Sum(nil)
+	nw, err := w.Write(sum)
+	buf.tot += int64(nw)
+	if err != nil {
+		return buf.tot, f.m, err
+	}
+	return buf.tot, f.m, nil
+}
@@ -18,33 +18,63 @@ import (
 	"io"
 )
 
-func unmarshalBinaryHeader(r io.Reader) (k, n, m uint64, err error) {
-	err = binary.Read(r, binary.LittleEndian, &k)
+// doubleHashFlag, set on the wire-format k field's top bit, marks a
+// Filter that stores only 2 seeds and derives its k bit positions via
+// Kirsch-Mitzenmacher double hashing, instead of k independent keys. It
+// lives in the k field itself (rather than a new header byte) so the
+// classic-mode wire format is pixel-for-pixel the legacy [k][n][m]
+// layout: a real k is always far smaller than 1<<63, so a legacy
+// classic file's k field can never be mistaken for a flagged one.
+const doubleHashFlag = uint64(1) << 63
+
+// maxStoredKeys bounds the key/derived-position count accepted from an
+// untrusted header, so a corrupt or malicious file can't turn into a
+// multi-exabyte allocation attempt in unmarshalBinaryKeys.
+const maxStoredKeys = 1 << 20
+
+// unmarshalBinaryHeader reads the wire header of a Filter. storedKeys is
+// the number of uint64 keys that follow (k in classic mode, always 2
+// double-hashing seeds in double-hash mode); dhK is the number of derived
+// bit positions per item and is only meaningful in double-hash mode.
+func unmarshalBinaryHeader(r io.Reader) (mode hashMode, storedKeys, dhK, n, m uint64, err error) {
+	var kField uint64
+	err = binary.Read(r, binary.LittleEndian, &kField)
 	if err != nil {
-		return k, n, m, err
+		return mode, storedKeys, dhK, n, m, err
 	}
 
-	if k < KMin {
-		return k, n, m, errK()
+	if kField&doubleHashFlag != 0 {
+		mode = modeDoubleHash
+		dhK = kField &^ doubleHashFlag
+		storedKeys = 2
+		if dhK < KMin || dhK > maxStoredKeys {
+			return mode, storedKeys, dhK, n, m, errK()
+		}
+	} else {
+		mode = modeClassic
+		storedKeys = kField
+		if storedKeys < KMin || storedKeys > maxStoredKeys {
+			return mode, storedKeys, dhK, n, m, errK()
+		}
 	}
 
 	err = binary.Read(r, binary.LittleEndian, &n)
 	if err != nil {
-		return k, n, m, err
+		return mode, storedKeys, dhK, n, m, err
 	}
 
 	err = binary.Read(r, binary.LittleEndian, &m)
 	if err != nil {
-		return k, n, m, err
+		return mode, storedKeys, dhK, n, m, err
 	}
 
 	if m < MMin {
-		return k, n, m, errM()
+		return mode, storedKeys, dhK, n, m, errM()
 	}
 
-	debug("read bf k=%d n=%d m=%d\n", k, n, m)
+	debug("read bf mode=%v k=%d n=%d m=%d\n", mode, storedKeys, n, m)
 
-	return k, n, m, err
+	return mode, storedKeys, dhK, n, m, err
 }
 
 func unmarshalBinaryBits(r io.Reader, m uint64) (bits []uint64, err error) {
@@ -102,13 +132,14 @@ func (f *Filter) UnmarshalFromReader(input io.Reader) (n int64, err error) {
 		reader: input,
 		hasher: sha512.New384(),
 	}
-	var k uint64
-	k, f.n, f.m, err = unmarshalBinaryHeader(buf)
+	var storedKeys, dhK uint64
+	f.mode, storedKeys, dhK, f.n, f.m, err = unmarshalBinaryHeader(buf)
 	if err != nil {
 		return buf.tot, err
 	}
+	f.k = dhK
 
-	f.keys, err = unmarshalBinaryKeys(buf, k)
+	f.keys, err = unmarshalBinaryKeys(buf, storedKeys)
 	if err != nil {
 		return buf.tot, err
 	}
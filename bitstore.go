@@ -0,0 +1,128 @@
+// Package bloomfilter is face-meltingly fast, thread-safe,
+// marshalable, unionable, probability- and
+// optimal-size-calculating Bloom filter in go
+//
+// https://github.com/steakknife/bloomfilter
+//
+// Copyright © 2014, 2015, 2018 Barry Allard
+//
+// MIT license
+//
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+)
+
+// bitStore is a storage backend for a bit array addressed by bit index
+// in [0, m). It lets SparseFilter swap a dense []uint64 word array for a
+// sparse, compressed representation without changing its Add/Contains/
+// Union surface.
+type bitStore interface {
+	Set(i uint64)
+	Test(i uint64) bool
+	// Or sets every bit that is set in o. Both stores must have the
+	// same m.
+	Or(o bitStore) error
+	// Len is the number of bits currently set.
+	Len() uint64
+	// SizeInBytes estimates the in-memory (uncompressed) footprint of
+	// the store.
+	SizeInBytes() uint64
+	// Serialize writes the store in its own binary format to w.
+	Serialize(w io.Writer) (int64, error)
+}
+
+// denseBitStore is the classic []uint64 word-packed bit-vector, the same
+// layout Filter has always used.
+type denseBitStore struct {
+	m       uint64
+	bits    []uint64
+	setBits uint64 // number of bits currently set, maintained incrementally so Len is O(1)
+}
+
+func newDenseBitStore(m uint64) *denseBitStore {
+	return &denseBitStore{m: m, bits: make([]uint64, (m+63)/64)}
+}
+
+func (d *denseBitStore) Set(i uint64) {
+	mask := uint64(1) << uint(i&0x3f)
+	if d.bits[i>>6]&mask == 0 {
+		d.setBits++
+	}
+	d.bits[i>>6] |= mask
+}
+
+func (d *denseBitStore) Test(i uint64) bool {
+	return d.bits[i>>6]&(1<<uint(i&0x3f)) != 0
+}
+
+func (d *denseBitStore) Or(o bitStore) error {
+	if o2, ok := o.(*denseBitStore); ok {
+		for i, w := range o2.bits {
+			d.bits[i] |= w
+		}
+		d.setBits = d.countSetBits()
+		return nil
+	}
+	for i := uint64(0); i < d.m; i++ {
+		if o.Test(i) {
+			d.Set(i)
+		}
+	}
+	return nil
+}
+
+// countSetBits recomputes the true popcount of d.bits. It is O(m) and
+// meant only for the rare paths (Or, loading bits read directly off the
+// wire) where setBits can't be maintained incrementally through Set.
+func (d *denseBitStore) countSetBits() uint64 {
+	var n uint64
+	for _, w := range d.bits {
+		n += uint64(bits.OnesCount64(w))
+	}
+	return n
+}
+
+// Len returns the number of set bits in O(1), tracked incrementally by
+// Set/Or/recount rather than popcounting the whole array on every call —
+// this is on SparseFilter's AddHash hot path via autoSwitch.
+func (d *denseBitStore) Len() uint64 {
+	return d.setBits
+}
+
+// recount refreshes setBits from scratch. Callers that populate d.bits
+// directly (bypassing Set), such as ReadFrom decoding wire bits straight
+// into the slice, must call this afterwards.
+func (d *denseBitStore) recount() {
+	d.setBits = d.countSetBits()
+}
+
+func (d *denseBitStore) SizeInBytes() uint64 {
+	return uint64(len(d.bits)) * Uint64Bytes
+}
+
+func (d *denseBitStore) Serialize(w io.Writer) (int64, error) {
+	err := binary.Write(w, binary.LittleEndian, d.bits)
+	if err != nil {
+		return 0, err
+	}
+	return int64(d.SizeInBytes()), nil
+}
+
+// compact converts d into the equivalent sparseBitStore. It returns an
+// error only if d.m is too large for roaring's uint32 index space.
+func (d *denseBitStore) compact() (*sparseBitStore, error) {
+	s, err := newSparseBitStore(d.m)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < d.m; i++ {
+		if d.Test(i) {
+			s.Set(i)
+		}
+	}
+	return s, nil
+}
@@ -15,6 +15,20 @@ import (
 	"sync"
 )
 
+// hashMode selects how a Filter turns one 64-bit hash into its k bit
+// positions.
+type hashMode uint8
+
+const (
+	// modeClassic XORs the hash with each of k independently-generated
+	// keys, so the filter stores k*8 bytes of keys.
+	modeClassic hashMode = iota
+	// modeDoubleHash derives all k positions from just two stored seeds,
+	// per Kirsch and Mitzenmacher, "Less Hashing, Same Performance:
+	// Building a Better Bloom Filter" (2006).
+	modeDoubleHash
+)
+
 // Filter is an opaque Bloom filter type
 type Filter struct {
 	lock sync.RWMutex
@@ -22,6 +36,8 @@ type Filter struct {
 	keys []uint64
 	m    uint64 // number of bits the "bits" field should recognize
 	n    uint64 // number of inserted elements
+	mode hashMode
+	k    uint64 // number of bit positions per item; only used in modeDoubleHash
 }
 
 // M is the size of Bloom filter, in bits
@@ -30,23 +46,18 @@ func (f *Filter) M() uint64 {
 }
 
 // K is the count of keys
+// In double-hash mode it is the number of derived bit positions per item,
+// not the 2 stored seeds.
 func (f *Filter) K() uint64 {
+	if f.mode == modeDoubleHash {
+		return f.k
+	}
 	return uint64(len(f.keys))
 }
 
 // Add a hashable item, v, to the filter
 func (f *Filter) Add(v hash.Hash64) {
-	f.lock.Lock()
-	defer f.lock.Unlock()
-	var (
-		hash = v.Sum64()
-		i    uint64
-	)
-	for n := 0; n < len(f.keys); n++ {
-		i = (hash ^ f.keys[n]) % f.m
-		f.bits[i>>6] |= 1 << uint(i&0x3f)
-	}
-	f.n++
+	f.AddHash(v.Sum64())
 }
 
 // Adds an already hashes item to the filter.
@@ -54,26 +65,54 @@ func (f *Filter) Add(v hash.Hash64) {
 func (f *Filter) AddHash(hash uint64) {
 	f.lock.Lock()
 	defer f.lock.Unlock()
-	var (
-		i uint64
-	)
+	if f.mode == modeDoubleHash {
+		f.addHashDouble(hash)
+	} else {
+		f.addHashClassic(hash)
+	}
+	f.n++
+}
+
+func (f *Filter) addHashClassic(hash uint64) {
+	var i uint64
 	for n := 0; n < len(f.keys); n++ {
 		i = (hash ^ f.keys[n]) % f.m
 		f.bits[i>>6] |= 1 << uint(i&0x3f)
 	}
-	f.n++
+}
+
+func (f *Filter) addHashDouble(hash uint64) {
+	h1 := hash ^ f.keys[0]
+	h2 := (hash ^ f.keys[1]) | 1
+	var i uint64
+	for n := uint64(0); n < f.k; n++ {
+		i = (h1 + n*h2) % f.m
+		f.bits[i>>6] |= 1 << uint(i&0x3f)
+	}
 }
 
 // Contains tests if f contains v
 // false: f definitely does not contain value v
 // true:  f maybe contains value v
 func (f *Filter) Contains(v hash.Hash64) bool {
+	return f.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if f contains the (already hashed) key
+// Identical to Contains but slightly faster
+func (f *Filter) ContainsHash(hash uint64) bool {
 	f.lock.RLock()
 	defer f.lock.RUnlock()
+	if f.mode == modeDoubleHash {
+		return f.containsHashDouble(hash)
+	}
+	return f.containsHashClassic(hash)
+}
+
+func (f *Filter) containsHashClassic(hash uint64) bool {
 	var (
-		hash = v.Sum64()
-		i    uint64
-		r    = uint64(1)
+		i uint64
+		r = uint64(1)
 	)
 	for n := 0; n < len(f.keys) && r != 0; n++ {
 		i = (hash ^ f.keys[n]) % f.m
@@ -82,17 +121,15 @@ func (f *Filter) Contains(v hash.Hash64) bool {
 	return uint64ToBool(r)
 }
 
-// ContainsHash tests if f contains the (already hashed) key
-// Identical to Contains but slightly faster
-func (f *Filter) ContainsHash(hash uint64) bool {
-	f.lock.RLock()
-	defer f.lock.RUnlock()
+func (f *Filter) containsHashDouble(hash uint64) bool {
+	h1 := hash ^ f.keys[0]
+	h2 := (hash ^ f.keys[1]) | 1
 	var (
 		i uint64
 		r = uint64(1)
 	)
-	for n := 0; n < len(f.keys) && r != 0; n++ {
-		i = (hash ^ f.keys[n]) % f.m
+	for n := uint64(0); n < f.k && r != 0; n++ {
+		i = (h1 + n*h2) % f.m
 		r &= (f.bits[i>>6] >> uint(i&0x3f)) & 1
 	}
 	return uint64ToBool(r)
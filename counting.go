@@ -0,0 +1,393 @@
+// Package bloomfilter is face-meltingly fast, thread-safe,
+// marshalable, unionable, probability- and
+// optimal-size-calculating Bloom filter in go
+//
+// https://github.com/steakknife/bloomfilter
+//
+// Copyright © 2014, 2015, 2018 Barry Allard
+//
+// MIT license
+//
+package bloomfilter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+)
+
+// countingMagic identifies the CountingFilter binary format on the wire,
+// so it can never be mistaken for a plain Filter's format, which has no
+// magic number of its own.
+const countingMagic uint64 = 0xC0117146BF17E4B1
+
+// countersPerWord is the number of 4-bit saturating counters packed into
+// each uint64 word of a CountingFilter.
+const countersPerWord = 16
+
+// counterMax is the highest value a counter can hold before it saturates
+const counterMax = 0xF
+
+// CountingFilter is a Bloom filter variant that replaces each bit with a
+// 4-bit saturating counter, so that items can be removed as well as
+// added. Counters saturate at counterMax rather than overflow, and a
+// saturated counter refuses to be decremented since that would make
+// Remove unsafe (the true count may be higher than 4 bits can record).
+type CountingFilter struct {
+	lock sync.RWMutex
+
+	counters []uint64
+	keys     []uint64
+	m        uint64 // number of counters the filter recognizes
+	n        uint64 // number of inserted elements
+}
+
+// M is the number of counters in the Counting Bloom filter
+func (cf *CountingFilter) M() uint64 {
+	return cf.m
+}
+
+// K is the count of keys
+func (cf *CountingFilter) K() uint64 {
+	return uint64(len(cf.keys))
+}
+
+func newCounters(m uint64) ([]uint64, error) {
+	if m < MMin {
+		return nil, fmt.Errorf("number of counters in the filter must be >= %d (was %d)", MMin, m)
+	}
+	return make([]uint64, (m+countersPerWord-1)/countersPerWord), nil
+}
+
+// NewCounting Filter with CSPRNG keys
+//
+// m is the number of counters in the filter, >= 2
+//
+// k is the number of random keys, >= 1
+func NewCounting(m, k uint64) (*CountingFilter, error) {
+	return NewCountingWithKeys(m, newRandKeys(m, k))
+}
+
+// NewCountingWithKeys creates a new CountingFilter from user-supplied origKeys
+func NewCountingWithKeys(m uint64, origKeys []uint64) (cf *CountingFilter, err error) {
+	counters, err := newCounters(m)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := newKeysCopy(origKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &CountingFilter{
+		m:        m,
+		n:        0,
+		counters: counters,
+		keys:     keys,
+	}, nil
+}
+
+// NewOptimalCounting Bloom filter with random CSPRNG keys
+func NewOptimalCounting(maxN uint64, p float64) (*CountingFilter, error) {
+	m := OptimalM(maxN, p)
+	k := OptimalK(m, maxN)
+	return NewCounting(m, k)
+}
+
+// counterAt returns the value of the counter at bit index i
+func (cf *CountingFilter) counterAt(i uint64) uint64 {
+	shift := (i % countersPerWord) * 4
+	return (cf.counters[i/countersPerWord] >> shift) & counterMax
+}
+
+// incrSaturating increments the counter at bit index i, saturating at counterMax
+func (cf *CountingFilter) incrSaturating(i uint64) {
+	if cf.counterAt(i) == counterMax {
+		return
+	}
+	shift := (i % countersPerWord) * 4
+	cf.counters[i/countersPerWord] += 1 << shift
+}
+
+// decr decrements the counter at bit index i. Callers must ensure the
+// counter is not already zero or saturated.
+func (cf *CountingFilter) decr(i uint64) {
+	shift := (i % countersPerWord) * 4
+	cf.counters[i/countersPerWord] -= 1 << shift
+}
+
+func (cf *CountingFilter) indexesFor(hash uint64) []uint64 {
+	indexes := make([]uint64, len(cf.keys))
+	for n := 0; n < len(cf.keys); n++ {
+		indexes[n] = (hash ^ cf.keys[n]) % cf.m
+	}
+	return indexes
+}
+
+// Add a hashable item, v, to the filter
+func (cf *CountingFilter) Add(v hash.Hash64) {
+	cf.AddHash(v.Sum64())
+}
+
+// AddHash adds an already-hashed item to the filter.
+// Identical to Add (but slightly faster)
+func (cf *CountingFilter) AddHash(hash uint64) {
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+
+	for _, i := range cf.indexesFor(hash) {
+		cf.incrSaturating(i)
+	}
+	cf.n++
+}
+
+// Contains tests if cf contains v
+// false: cf definitely does not contain value v
+// true:  cf maybe contains value v
+func (cf *CountingFilter) Contains(v hash.Hash64) bool {
+	return cf.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if cf contains the (already hashed) key
+// Identical to Contains but slightly faster
+func (cf *CountingFilter) ContainsHash(hash uint64) bool {
+	cf.lock.RLock()
+	defer cf.lock.RUnlock()
+
+	for _, i := range cf.indexesFor(hash) {
+		if cf.counterAt(i) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove a hashable item, v, from the filter. It is only safe to remove
+// an item that was previously added and is still reported by Contains;
+// Remove returns an error if Contains would report the item absent (it
+// cannot tell a false positive from an added item), or if any of the item's
+// counters have saturated, since a saturated counter may be hiding an
+// undercount and decrementing it could make Contains return false for
+// an item that is still present elsewhere.
+func (cf *CountingFilter) Remove(v hash.Hash64) error {
+	return cf.RemoveHash(v.Sum64())
+}
+
+// RemoveHash removes an already-hashed item from the filter.
+// Identical to Remove but slightly faster
+func (cf *CountingFilter) RemoveHash(hash uint64) error {
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+
+	indexes := cf.indexesFor(hash)
+	for _, i := range indexes {
+		if cf.counterAt(i) == 0 {
+			return errNotContained()
+		}
+		if cf.counterAt(i) == counterMax {
+			return errSaturatedCounter()
+		}
+	}
+	for _, i := range indexes {
+		cf.decr(i)
+	}
+	cf.n--
+	return nil
+}
+
+// IsCompatible is true if cf and cf2 are both Counting Bloom filters with
+// the same m and the same keys in the same order
+func (cf *CountingFilter) IsCompatible(cf2 *CountingFilter) bool {
+	if cf.m != cf2.m || len(cf.keys) != len(cf2.keys) {
+		return false
+	}
+	for i, key := range cf.keys {
+		if key != cf2.keys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// UnionInPlace merges CountingFilter cf2 into cf, adding counters pairwise
+// with saturation at counterMax
+func (cf *CountingFilter) UnionInPlace(cf2 *CountingFilter) error {
+	if !cf.IsCompatible(cf2) {
+		return errIncompatibleBloomFilters()
+	}
+
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+
+	for i := uint64(0); i < cf.m; i++ {
+		v2 := cf2.counterAt(i)
+		for ; v2 > 0 && cf.counterAt(i) < counterMax; v2-- {
+			cf.incrSaturating(i)
+		}
+	}
+	cf.n += cf2.n
+	return nil
+}
+
+// ToFilter projects the nonzero counters of cf back into a standard
+// bit-vector Filter, sharing cf's m and keys. This is useful for cheap
+// point queries or gossiping a snapshot of cf without its counts.
+func (cf *CountingFilter) ToFilter() *Filter {
+	cf.lock.RLock()
+	defer cf.lock.RUnlock()
+
+	// cf.keys are already validated unique and cf.m >= MMin, so this
+	// cannot fail.
+	f, _ := newWithKeysAndBits(cf.m, cf.keys, make([]uint64, (cf.m+63)/64), cf.n)
+	for i := uint64(0); i < cf.m; i++ {
+		if cf.counterAt(i) != 0 {
+			f.bits[i>>6] |= 1 << uint(i&0x3f)
+		}
+	}
+	return f
+}
+
+func errNotContained() error {
+	return fmt.Errorf("item is not (definitely) contained in the filter, refusing to remove it")
+}
+
+func errSaturatedCounter() error {
+	return fmt.Errorf("one or more counters for this item have saturated at %d, refusing to remove it", counterMax)
+}
+
+// MarshalBinary converts a CountingFilter into []bytes
+// conforms to encoding.BinaryMarshaler
+func (cf *CountingFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := cf.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary converts []bytes into a CountingFilter
+// conforms to encoding.BinaryUnmarshaler
+func (cf *CountingFilter) UnmarshalBinary(data []byte) (err error) {
+	buf := bytes.NewBuffer(data)
+	_, err = cf.ReadFrom(buf)
+	return err
+}
+
+// WriteTo a Writer w from a lossless-compressed CountingFilter cf
+func (cf *CountingFilter) WriteTo(w io.Writer) (n int64, err error) {
+	cf.lock.RLock()
+	defer cf.lock.RUnlock()
+
+	gzW := gzip.NewWriter(w)
+	defer func() {
+		err = gzW.Close()
+	}()
+
+	hasher := sha512.New384()
+	tee := io.MultiWriter(gzW, hasher)
+
+	for _, field := range []interface{}{countingMagic, uint64(len(cf.keys)), cf.n, cf.m, cf.keys, cf.counters} {
+		if err = binary.Write(tee, binary.LittleEndian, field); err != nil {
+			return n, err
+		}
+	}
+
+	if err = binary.Write(gzW, binary.LittleEndian, hasher.Sum(nil)); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// ReadFrom r and overwrite cf with a new CountingFilter
+func (cf *CountingFilter) ReadFrom(r io.Reader) (n int64, err error) {
+	gzR, err := gzip.NewReader(r)
+	if err != nil {
+		return -1, err
+	}
+	defer gzR.Close()
+
+	hasher := sha512.New384()
+	tee := io.TeeReader(gzR, hasher)
+
+	var magic, k, cn, m uint64
+	if err = binary.Read(tee, binary.LittleEndian, &magic); err != nil {
+		return -1, err
+	}
+	if magic != countingMagic {
+		return -1, fmt.Errorf("not a CountingFilter (bad magic)")
+	}
+	if err = binary.Read(tee, binary.LittleEndian, &k); err != nil {
+		return -1, err
+	}
+	if err = binary.Read(tee, binary.LittleEndian, &cn); err != nil {
+		return -1, err
+	}
+	if err = binary.Read(tee, binary.LittleEndian, &m); err != nil {
+		return -1, err
+	}
+	if m < MMin {
+		return -1, errM()
+	}
+
+	keys := make([]uint64, k)
+	if err = binary.Read(tee, binary.LittleEndian, keys); err != nil {
+		return -1, err
+	}
+	counters := make([]uint64, (m+countersPerWord-1)/countersPerWord)
+	if err = binary.Read(tee, binary.LittleEndian, counters); err != nil {
+		return -1, err
+	}
+
+	gotHash := hasher.Sum(nil)
+	expHash := make([]byte, sha512.Size384)
+	if err = binary.Read(gzR, binary.LittleEndian, expHash); err != nil {
+		return -1, err
+	}
+	if !bytes.Equal(gotHash, expHash) {
+		return -1, errHash()
+	}
+
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+	cf.keys = keys
+	cf.counters = counters
+	cf.m = m
+	cf.n = cn
+	return 0, nil
+}
+
+// ReadCountingFile from filename into a lossless-compressed CountingFilter
+// Suggested file extension: .cbf.gz
+func ReadCountingFile(filename string) (cf *CountingFilter, n int64, err error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer r.Close()
+
+	cf = new(CountingFilter)
+	n, err = cf.ReadFrom(r)
+	if err != nil {
+		return nil, -1, err
+	}
+	return cf, n, nil
+}
+
+// WriteFile filename from a lossless-compressed CountingFilter cf
+// Suggested file extension: .cbf.gz
+func (cf *CountingFilter) WriteFile(filename string) (n int64, err error) {
+	w, err := os.Create(filename)
+	if err != nil {
+		return -1, err
+	}
+	defer func() {
+		err = w.Close()
+	}()
+
+	return cf.WriteTo(w)
+}
@@ -0,0 +1,56 @@
+package bloomfilter
+
+import "testing"
+
+func TestCountingFilterSaturationBlocksRemove(t *testing.T) {
+	cf, err := NewCounting(64, 2)
+	if err != nil {
+		t.Fatalf("NewCounting: %v", err)
+	}
+
+	for i := 0; i < counterMax; i++ {
+		cf.AddHash(1)
+	}
+	if !cf.ContainsHash(1) {
+		t.Fatalf("ContainsHash(1) = false, want true")
+	}
+	if err := cf.RemoveHash(1); err == nil {
+		t.Fatalf("RemoveHash on a saturated counter should fail")
+	}
+}
+
+func TestCountingFilterRemoveUnseenFails(t *testing.T) {
+	cf, err := NewCounting(64, 2)
+	if err != nil {
+		t.Fatalf("NewCounting: %v", err)
+	}
+	if err := cf.RemoveHash(42); err == nil {
+		t.Fatalf("RemoveHash on an item never added should fail")
+	}
+}
+
+func TestCountingFilterMarshalBinaryRoundTrip(t *testing.T) {
+	cf, err := NewCounting(256, 3)
+	if err != nil {
+		t.Fatalf("NewCounting: %v", err)
+	}
+	for i := uint64(0); i < 20; i++ {
+		cf.AddHash(i)
+	}
+
+	data, err := cf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+
+	loaded := new(CountingFilter)
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+
+	for i := uint64(0); i < 20; i++ {
+		if !loaded.ContainsHash(i) {
+			t.Fatalf("loaded filter does not contain hash %d", i)
+		}
+	}
+}
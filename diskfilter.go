@@ -0,0 +1,351 @@
+// Package bloomfilter is face-meltingly fast, thread-safe,
+// marshalable, unionable, probability- and
+// optimal-size-calculating Bloom filter in go
+//
+// https://github.com/steakknife/bloomfilter
+//
+// Copyright © 2014, 2015, 2018 Barry Allard
+//
+// MIT license
+//
+//go:build linux || darwin
+
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// diskFilterMagic identifies a DiskFilter file on disk.
+const diskFilterMagic uint64 = 0xD15C0BF17E8A6161
+
+// diskFilterVersion is the on-disk format version of a DiskFilter file.
+const diskFilterVersion uint32 = 1
+
+// diskHeaderLen is the number of bytes occupied by a DiskFilter's fixed
+// header (magic, version, m, n, k) plus its k keys.
+func diskHeaderLen(k uint64) int64 {
+	return 8 + 4 + 8 + 8 + 8 + int64(k)*Uint64Bytes
+}
+
+// DiskFilter is a Bloom filter whose bit array lives on disk and is
+// addressed by mmap, so it can be far larger than RAM. Contains answers
+// with k page-ins rather than loading the whole bit vector; Add mutates
+// the mapping directly, so changes are visible to other readers of the
+// same mapping without an explicit save.
+//
+// Layout: a fixed header (magic, version, m, n, k, keys...) followed by
+// the raw little-endian uint64 bit words, so bit index i lives at file
+// offset headerLen + (i>>6)*8.
+type DiskFilter struct {
+	lock sync.RWMutex
+
+	file      *os.File
+	data      []byte
+	headerLen int64
+	writable  bool
+
+	m, n uint64
+	keys []uint64
+}
+
+// M is the size of the Bloom filter, in bits
+func (df *DiskFilter) M() uint64 {
+	return df.m
+}
+
+// K is the count of keys
+func (df *DiskFilter) K() uint64 {
+	return uint64(len(df.keys))
+}
+
+// CreateFile creates a new DiskFilter file at path sized for m bits and
+// k keys, and mmaps it read/write for Add.
+func CreateFile(path string, m, k uint64) (df *DiskFilter, err error) {
+	if m < MMin {
+		return nil, errM()
+	}
+	if k < KMin {
+		return nil, errK()
+	}
+
+	keys, err := newKeysCopy(newRandKeys(m, k))
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := diskHeaderLen(k)
+	bitsLen := int64((m + 63) / 64 * 8)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+		}
+	}()
+
+	if err = writeDiskHeader(file, m, 0, keys); err != nil {
+		return nil, err
+	}
+	if err = file.Truncate(headerLen + bitsLen); err != nil {
+		return nil, err
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(headerLen+bitsLen),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiskFilter{
+		file:      file,
+		data:      data,
+		headerLen: headerLen,
+		writable:  true,
+		m:         m,
+		n:         0,
+		keys:      keys,
+	}, nil
+}
+
+// OpenFile opens an existing DiskFilter file at path and mmaps it
+// read-only for Contains.
+func OpenFile(path string) (df *DiskFilter, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+		}
+	}()
+
+	m, n, keys, err := readDiskHeader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := diskHeaderLen(uint64(len(keys)))
+	bitsLen := int64((m + 63) / 64 * 8)
+	if info.Size() < headerLen+bitsLen {
+		return nil, fmt.Errorf("DiskFilter file %s is truncated: have %d bytes, want at least %d", path, info.Size(), headerLen+bitsLen)
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()),
+		syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	madviseRandom(data)
+
+	return &DiskFilter{
+		file:      file,
+		data:      data,
+		headerLen: headerLen,
+		writable:  false,
+		m:         m,
+		n:         n,
+		keys:      keys,
+	}, nil
+}
+
+func writeDiskHeader(w *os.File, m, n uint64, keys []uint64) error {
+	for _, field := range []interface{}{diskFilterMagic, diskFilterVersion, m, n, uint64(len(keys)), keys} {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readDiskHeader(r *os.File) (m, n uint64, keys []uint64, err error) {
+	var magic uint64
+	var version uint32
+	var k uint64
+
+	if err = binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return m, n, keys, err
+	}
+	if magic != diskFilterMagic {
+		return m, n, keys, fmt.Errorf("not a DiskFilter file (bad magic)")
+	}
+	if err = binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return m, n, keys, err
+	}
+	if version != diskFilterVersion {
+		return m, n, keys, fmt.Errorf("unsupported DiskFilter version %d", version)
+	}
+	if err = binary.Read(r, binary.LittleEndian, &m); err != nil {
+		return m, n, keys, err
+	}
+	if m < MMin {
+		return m, n, keys, errM()
+	}
+	if err = binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return m, n, keys, err
+	}
+	if err = binary.Read(r, binary.LittleEndian, &k); err != nil {
+		return m, n, keys, err
+	}
+	if k < KMin {
+		return m, n, keys, errK()
+	}
+	keys = make([]uint64, k)
+	if err = binary.Read(r, binary.LittleEndian, keys); err != nil {
+		return m, n, keys, err
+	}
+	return m, n, keys, nil
+}
+
+func (df *DiskFilter) wordOffset(i uint64) int64 {
+	return df.headerLen + int64(i>>6)*Uint64Bytes
+}
+
+// Add a hashable item, v, to the filter
+func (df *DiskFilter) Add(v hash.Hash64) error {
+	return df.AddHash(v.Sum64())
+}
+
+// AddHash adds an already-hashed item to the filter.
+// Identical to Add (but slightly faster). AddHash returns an error if df
+// was opened with OpenFile, whose mapping is PROT_READ only: writing into
+// a read-only mapping would fault with SIGBUS/SIGSEGV rather than return
+// a Go error, so this is checked up front instead.
+func (df *DiskFilter) AddHash(hash uint64) error {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	if !df.writable {
+		return errReadOnlyDiskFilter()
+	}
+
+	for _, key := range df.keys {
+		i := (hash ^ key) % df.m
+		off := df.wordOffset(i)
+		word := binary.LittleEndian.Uint64(df.data[off : off+8])
+		word |= 1 << uint(i&0x3f)
+		binary.LittleEndian.PutUint64(df.data[off:off+8], word)
+	}
+	df.n++
+	// n lives right after magic(8)+version(4)+m(8) in the header.
+	const nOffset = 8 + 4 + 8
+	binary.LittleEndian.PutUint64(df.data[nOffset:nOffset+8], df.n)
+	return nil
+}
+
+func errReadOnlyDiskFilter() error {
+	return fmt.Errorf("DiskFilter was opened read-only with OpenFile; only a DiskFilter from CreateFile accepts Add")
+}
+
+// errDiskFilterDoubleHashUnsupported is returned by WriteMmapFile for a
+// double-hash Filter: DiskFilter's on-disk format stores one key per bit
+// index and has no way to record that a Filter derives its k positions
+// from 2 seeds instead, so writing one out would silently produce a file
+// that OpenFile/ContainsHash would misread as a classic filter.
+func errDiskFilterDoubleHashUnsupported() error {
+	return fmt.Errorf("WriteMmapFile does not support double-hash Filters; use a classic (per-key) Filter")
+}
+
+// Contains tests if df contains v
+// false: df definitely does not contain value v
+// true:  df maybe contains value v
+func (df *DiskFilter) Contains(v hash.Hash64) bool {
+	return df.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if df contains the (already hashed) key. Only the
+// 8 bytes containing each of the k bits are read, so this touches at
+// most k pages of the mapping rather than the whole bit array.
+func (df *DiskFilter) ContainsHash(hash uint64) bool {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	for _, key := range df.keys {
+		i := (hash ^ key) % df.m
+		off := df.wordOffset(i)
+		word := binary.LittleEndian.Uint64(df.data[off : off+8])
+		if word&(1<<uint(i&0x3f)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Close flushes a writable DiskFilter's mapping back to disk and
+// releases the mapping and file handle.
+func (df *DiskFilter) Close() error {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	if df.writable {
+		if err := msync(df.data); err != nil {
+			return err
+		}
+	}
+	if err := syscall.Munmap(df.data); err != nil {
+		return err
+	}
+	return df.file.Close()
+}
+
+// LoadInMemory reads df's entire bit array into a regular, in-memory
+// Filter, for when there is enough RAM after all and the speed of the
+// classic representation is worth the copy.
+func (df *DiskFilter) LoadInMemory() (*Filter, error) {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	bits := make([]uint64, (df.m+63)/64)
+	r := bytes.NewReader(df.data[df.headerLen:])
+	if err := binary.Read(r, binary.LittleEndian, bits); err != nil {
+		return nil, err
+	}
+	return newWithKeysAndBits(df.m, df.keys, bits, df.n)
+}
+
+// WriteMmapFile writes f in DiskFilter's on-disk format to a new file
+// at path, so it can later be reopened read-only with OpenFile without
+// loading the whole bit vector into RAM. CreateFile always starts a new,
+// empty file, so it cannot reopen one written here.
+func (f *Filter) WriteMmapFile(path string) (n int64, err error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if f.mode == modeDoubleHash {
+		return 0, errDiskFilterDoubleHashUnsupported()
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		cerr := file.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+
+	if err = writeDiskHeader(file, f.m, f.n, f.keys); err != nil {
+		return 0, err
+	}
+	if err = binary.Write(file, binary.LittleEndian, f.bits); err != nil {
+		return 0, err
+	}
+	return diskHeaderLen(uint64(len(f.keys))) + int64(len(f.bits))*Uint64Bytes, nil
+}
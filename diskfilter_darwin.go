@@ -0,0 +1,24 @@
+// Package bloomfilter is face-meltingly fast, thread-safe,
+// marshalable, unionable, probability- and
+// optimal-size-calculating Bloom filter in go
+//
+// https://github.com/steakknife/bloomfilter
+//
+// Copyright © 2014, 2015, 2018 Barry Allard
+//
+// MIT license
+//
+//go:build darwin
+
+package bloomfilter
+
+import "golang.org/x/sys/unix"
+
+// madviseRandom is a no-op outside Linux; MADV_RANDOM readahead hinting
+// is applied there only, per the DiskFilter design.
+func madviseRandom(data []byte) {
+}
+
+func msync(data []byte) error {
+	return unix.Msync(data, unix.MS_SYNC)
+}
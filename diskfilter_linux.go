@@ -0,0 +1,27 @@
+// Package bloomfilter is face-meltingly fast, thread-safe,
+// marshalable, unionable, probability- and
+// optimal-size-calculating Bloom filter in go
+//
+// https://github.com/steakknife/bloomfilter
+//
+// Copyright © 2014, 2015, 2018 Barry Allard
+//
+// MIT license
+//
+//go:build linux
+
+package bloomfilter
+
+import "golang.org/x/sys/unix"
+
+// madviseRandom hints to the kernel that data will be accessed in
+// random order, so it should not bother with sequential readahead. This
+// matters for a DiskFilter, whose Contains touches a handful of
+// essentially-random pages per lookup.
+func madviseRandom(data []byte) {
+	_ = unix.Madvise(data, unix.MADV_RANDOM)
+}
+
+func msync(data []byte) error {
+	return unix.Msync(data, unix.MS_SYNC)
+}
@@ -0,0 +1,108 @@
+//go:build linux || darwin
+
+package bloomfilter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskFilterAddContainsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.bf")
+
+	df, err := CreateFile(path, 4096, 4)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	for i := uint64(0); i < 50; i++ {
+		if err := df.AddHash(i); err != nil {
+			t.Fatalf("AddHash(%d): %v", i, err)
+		}
+	}
+	for i := uint64(0); i < 50; i++ {
+		if !df.ContainsHash(i) {
+			t.Fatalf("ContainsHash(%d) = false, want true", i)
+		}
+	}
+	if err := df.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// TestDiskFilterOpenFileAddHashFails ensures writing to a DiskFilter
+// opened read-only with OpenFile returns an error instead of faulting on
+// the read-only mmap.
+func TestDiskFilterOpenFileAddHashFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.bf")
+
+	df, err := CreateFile(path, 4096, 4)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	if err := df.AddHash(1); err != nil {
+		t.Fatalf("AddHash: %v", err)
+	}
+	if err := df.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	ro, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer ro.Close()
+
+	if !ro.ContainsHash(1) {
+		t.Fatalf("ContainsHash(1) = false, want true")
+	}
+	if err := ro.AddHash(2); err == nil {
+		t.Fatalf("AddHash on a read-only DiskFilter should fail, not fault")
+	}
+}
+
+// TestOpenFileRejectsTruncatedFile ensures a corrupt/truncated DiskFilter
+// file is rejected by OpenFile with an error, instead of later panicking
+// in ContainsHash with a slice-bounds-out-of-range when it reads past the
+// end of the undersized mapping.
+func TestOpenFileRejectsTruncatedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.bf")
+
+	df, err := CreateFile(path, 4096, 4)
+	if err != nil {
+		t.Fatalf("CreateFile: %v", err)
+	}
+	if err := df.AddHash(1); err != nil {
+		t.Fatalf("AddHash: %v", err)
+	}
+	if err := df.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Keep the header intact but cut the bit array short, so the header
+	// parses and only the size check can reject the file.
+	if err := os.Truncate(path, diskHeaderLen(4)+Uint64Bytes); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+
+	if _, err := OpenFile(path); err == nil {
+		t.Fatalf("OpenFile on a truncated file should fail, not succeed")
+	}
+}
+
+// TestWriteMmapFileRejectsDoubleHash ensures a double-hash Filter, which
+// DiskFilter's on-disk format has no way to represent, is rejected by
+// WriteMmapFile rather than silently written out as a misleading
+// classic-format file.
+func TestWriteMmapFileRejectsDoubleHash(t *testing.T) {
+	f, err := NewDoubleHash(4096, 4)
+	if err != nil {
+		t.Fatalf("NewDoubleHash: %v", err)
+	}
+	f.AddHash(1)
+
+	path := filepath.Join(t.TempDir(), "test.bf")
+	if _, err := f.WriteMmapFile(path); err == nil {
+		t.Fatalf("WriteMmapFile on a double-hash Filter should fail, not succeed")
+	}
+}
@@ -0,0 +1,140 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDoubleHashMarshalRoundTrip(t *testing.T) {
+	f, err := NewDoubleHash(10000, 7)
+	if err != nil {
+		t.Fatalf("NewDoubleHash: %v", err)
+	}
+	for i := uint64(0); i < 50; i++ {
+		f.AddHash(i)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	f2, _, err := ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if f2.mode != modeDoubleHash || f2.k != 7 {
+		t.Fatalf("loaded mode=%v k=%d, want double-hash mode with k=7", f2.mode, f2.k)
+	}
+	for i := uint64(0); i < 50; i++ {
+		if !f2.ContainsHash(i) {
+			t.Fatalf("loaded filter missing hash %d after round-trip", i)
+		}
+	}
+}
+
+func TestClassicMarshalRoundTrip(t *testing.T) {
+	f, err := New(10000, 7)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := uint64(0); i < 50; i++ {
+		f.AddHash(i)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	f2, _, err := ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if f2.mode != modeClassic {
+		t.Fatalf("loaded mode=%v, want classic", f2.mode)
+	}
+	for i := uint64(0); i < 50; i++ {
+		if !f2.ContainsHash(i) {
+			t.Fatalf("loaded filter missing hash %d after round-trip", i)
+		}
+	}
+}
+
+// TestClassicBinaryFormatIsLegacyLayout pins the classic-mode wire format
+// to the original [k][n][m] header (no prepended flags byte), so classic
+// Filters serialized before double hashing existed keep deserializing.
+func TestClassicBinaryFormatIsLegacyLayout(t *testing.T) {
+	f, err := New(1000, 4)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f.AddHash(1)
+	f.AddHash(2)
+
+	var buf bytes.Buffer
+	if _, _, err := f.MarshallToWriter(&buf); err != nil {
+		t.Fatalf("MarshallToWriter: %v", err)
+	}
+
+	var kField uint64
+	if err := binary.Read(bytes.NewReader(buf.Bytes()[:8]), binary.LittleEndian, &kField); err != nil {
+		t.Fatal(err)
+	}
+	if kField != 4 {
+		t.Fatalf("first uint64 field = %d, want k=4 (the legacy layout's first field)", kField)
+	}
+
+	loaded := new(Filter)
+	if _, err := loaded.UnmarshalFromReader(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("UnmarshalFromReader: %v", err)
+	}
+	if loaded.mode != modeClassic || len(loaded.keys) != 4 {
+		t.Fatalf("loaded mode=%v keys=%d, want classic with 4 keys", loaded.mode, len(loaded.keys))
+	}
+	if !loaded.ContainsHash(1) || !loaded.ContainsHash(2) {
+		t.Fatalf("loaded filter missing inserted hashes")
+	}
+}
+
+// TestUnmarshalBinaryHeaderRejectsOutOfRangeK ensures a corrupt or
+// malicious k field returns an error instead of panicking while
+// allocating the keys slice.
+func TestUnmarshalBinaryHeaderRejectsOutOfRangeK(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(1)<<40) // garbage k
+	binary.Write(&buf, binary.LittleEndian, uint64(0))     // n
+	binary.Write(&buf, binary.LittleEndian, uint64(1000))  // m
+
+	loaded := new(Filter)
+	if _, err := loaded.UnmarshalFromReader(&buf); err == nil {
+		t.Fatalf("expected an error for an out-of-range k field, got nil")
+	}
+}
+
+func benchmarkAddHash(b *testing.B, f interface{ AddHash(uint64) }) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.AddHash(uint64(i))
+	}
+}
+
+// BenchmarkClassicAddHashK8 and BenchmarkDoubleHashAddHashK8 demonstrate
+// the win double hashing is meant for: at k=8, classic mode XORs 8 stored
+// keys per call while double-hash mode derives all 8 positions from 2.
+func BenchmarkClassicAddHashK8(b *testing.B) {
+	f, err := New(1<<20, 8)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkAddHash(b, f)
+}
+
+func BenchmarkDoubleHashAddHashK8(b *testing.B) {
+	f, err := NewDoubleHash(1<<20, 8)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkAddHash(b, f)
+}
@@ -30,6 +30,8 @@ func (f *Filter) ReadFrom(r io.Reader) (n int64, err error) {
 	f.n = f2.n
 	f.bits = f2.bits
 	f.keys = f2.keys
+	f.mode = f2.mode
+	f.k = f2.k
 	return n, nil
 }
 
@@ -90,11 +92,13 @@ func (f *Filter) WriteFile(filename string) (n int64, err error) {
 }
 
 type jsonType struct {
-	Version string   `json:"version"`
-	Bits    []uint64 `json:"bits"`
-	Keys    []uint64 `json:"keys"`
-	M       uint64   `json:"m"`
-	N       uint64   `json:"n"`
+	Version    string   `json:"version"`
+	Bits       []uint64 `json:"bits"`
+	Keys       []uint64 `json:"keys"`
+	M          uint64   `json:"m"`
+	N          uint64   `json:"n"`
+	DoubleHash bool     `json:"doubleHash,omitempty"`
+	DhK        uint64   `json:"dhK,omitempty"`
 }
 
 func (f *Filter) MarshalJSON() ([]byte, error) {
@@ -104,6 +108,8 @@ func (f *Filter) MarshalJSON() ([]byte, error) {
 		f.keys,
 		f.m,
 		f.n,
+		f.mode == modeDoubleHash,
+		f.k,
 	})
 }
 
@@ -119,5 +125,11 @@ func (f *Filter) UnmarshalJSON(data []byte) error {
 	f.keys = j.Keys
 	f.n = j.N
 	f.m = j.M
+	if j.DoubleHash {
+		f.mode = modeDoubleHash
+		f.k = j.DhK
+	} else {
+		f.mode = modeClassic
+	}
 	return nil
 }
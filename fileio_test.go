@@ -0,0 +1,55 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestFilterReadFromMethodCarriesDoubleHashMode(t *testing.T) {
+	f, err := NewDoubleHash(10000, 7)
+	if err != nil {
+		t.Fatalf("NewDoubleHash: %v", err)
+	}
+	f.AddHash(1)
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	loaded := new(Filter)
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatalf("(*Filter).ReadFrom: %v", err)
+	}
+	if loaded.mode != modeDoubleHash || loaded.k != 7 {
+		t.Fatalf("loaded mode=%v k=%d, want double-hash mode with k=7", loaded.mode, loaded.k)
+	}
+	if !loaded.ContainsHash(1) {
+		t.Fatalf("loaded filter should contain hash 1")
+	}
+}
+
+func TestFilterJSONRoundTripCarriesDoubleHashMode(t *testing.T) {
+	f, err := NewDoubleHash(10000, 7)
+	if err != nil {
+		t.Fatalf("NewDoubleHash: %v", err)
+	}
+	f.AddHash(1)
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+
+	loaded := new(Filter)
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if loaded.mode != modeDoubleHash || loaded.k != 7 {
+		t.Fatalf("loaded mode=%v k=%d, want double-hash mode with k=7", loaded.mode, loaded.k)
+	}
+	if !loaded.ContainsHash(1) {
+		t.Fatalf("loaded filter should contain hash 1")
+	}
+}
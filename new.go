@@ -57,6 +57,9 @@ func newRandKeys(m uint64, k uint64) []uint64 {
 
 // NewCompatible Filter compatible with f
 func (f *Filter) NewCompatible() (*Filter, error) {
+	if f.mode == modeDoubleHash {
+		return NewDoubleHashWithKeys(f.m, f.k, f.keys)
+	}
 	return NewWithKeys(f.m, f.keys)
 }
 
@@ -67,6 +70,54 @@ func NewOptimal(maxN uint64, p float64) (*Filter, error) {
 	return New(m, k)
 }
 
+// NewDoubleHash creates a new Filter with CSPRNG seeds that computes its k
+// bit positions via Kirsch-Mitzenmacher double hashing instead of storing
+// k independent keys. This trades a small amount of false-positive
+// probability for only 2 stored uint64 seeds, instead of k, which matters
+// once k grows past 8 or so.
+//
+// m is the size of the Bloom filter, in bits, >= 2
+//
+// k is the number of derived bit positions per item, >= 1
+func NewDoubleHash(m, k uint64) (*Filter, error) {
+	return NewDoubleHashWithKeys(m, k, newRandKeys(m, 2))
+}
+
+// NewDoubleHashWithKeys creates a new double-hashing Filter from the
+// user-supplied seeds s1, s2 (origSeeds must have length 2)
+func NewDoubleHashWithKeys(m, k uint64, origSeeds []uint64) (f *Filter, err error) {
+	if k < KMin {
+		return nil, fmt.Errorf("keys must have length %d or greater (was %d)", KMin, k)
+	}
+	if len(origSeeds) != 2 {
+		return nil, fmt.Errorf("double-hashing seeds must have length 2 (was %d)", len(origSeeds))
+	}
+
+	bits, err := newBits(m)
+	if err != nil {
+		return nil, err
+	}
+	seeds, err := newKeysCopy(origSeeds)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{
+		m:    m,
+		n:    0,
+		bits: bits,
+		keys: seeds,
+		mode: modeDoubleHash,
+		k:    k,
+	}, nil
+}
+
+// NewOptimalDoubleHash double-hashing Bloom filter with random CSPRNG seeds
+func NewOptimalDoubleHash(maxN uint64, p float64) (*Filter, error) {
+	m := OptimalM(maxN, p)
+	k := OptimalK(m, maxN)
+	return NewDoubleHash(m, k)
+}
+
 // uniqueKeys is true if all keys are unique
 func uniqueKeys(keys []uint64) bool {
 	for j := 0; j < len(keys)-1; j++ {
@@ -0,0 +1,252 @@
+// Package bloomfilter is face-meltingly fast, thread-safe,
+// marshalable, unionable, probability- and
+// optimal-size-calculating Bloom filter in go
+//
+// https://github.com/steakknife/bloomfilter
+//
+// Copyright © 2014, 2015, 2018 Barry Allard
+//
+// MIT license
+//
+package bloomfilter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+)
+
+// RollingFilter wraps a fixed number of generations of *Filter and
+// rotates them on a count or time trigger, so that items added longer
+// than the retention window ago eventually fall out. This bounds memory
+// and false-positive probability for streaming dedup use cases (network
+// sync pipelines, log ingestion, crawler URL frontiers) where the real
+// predicate is "seen in the last window", not "seen ever".
+type RollingFilter struct {
+	lock sync.RWMutex
+
+	generations []*Filter // oldest first, newest last
+	rotateEvery uint64
+
+	rotateDone chan struct{}
+	rotateWG   sync.WaitGroup
+}
+
+// NewRolling creates a RollingFilter of the given number of generations,
+// all sharing the m and keys of one NewOptimal(n, p) Filter, so every
+// generation is compatible with the others. Add writes to the newest
+// generation and automatically calls Rotate once it has seen
+// rotateEvery insertions.
+func NewRolling(generations int, n uint64, p float64, rotateEvery uint64) (*RollingFilter, error) {
+	if generations < 1 {
+		return nil, fmt.Errorf("generations must be >= 1 (was %d)", generations)
+	}
+	if rotateEvery < 1 {
+		return nil, fmt.Errorf("rotateEvery must be >= 1 (was %d)", rotateEvery)
+	}
+
+	gens := make([]*Filter, generations)
+	first, err := NewOptimal(n, p)
+	if err != nil {
+		return nil, err
+	}
+	gens[0] = first
+	for i := 1; i < generations; i++ {
+		f, err := first.NewCompatible()
+		if err != nil {
+			return nil, err
+		}
+		gens[i] = f
+	}
+	return &RollingFilter{
+		generations: gens,
+		rotateEvery: rotateEvery,
+	}, nil
+}
+
+// Add a hashable item, v, to the newest generation
+func (rf *RollingFilter) Add(v hash.Hash64) error {
+	return rf.AddHash(v.Sum64())
+}
+
+// AddHash adds an already-hashed item to the newest generation.
+// Identical to Add (but slightly faster)
+func (rf *RollingFilter) AddHash(hash uint64) error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	newest := rf.generations[len(rf.generations)-1]
+	newest.AddHash(hash)
+	if newest.n >= rf.rotateEvery {
+		return rf.rotateLocked()
+	}
+	return nil
+}
+
+// Contains tests if rf contains v
+// false: rf definitely does not contain value v
+// true:  rf maybe contains value v
+func (rf *RollingFilter) Contains(v hash.Hash64) bool {
+	return rf.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if rf contains the (already hashed) key
+// Identical to Contains but slightly faster
+func (rf *RollingFilter) ContainsHash(hash uint64) bool {
+	rf.lock.RLock()
+	defer rf.lock.RUnlock()
+
+	for _, gen := range rf.generations {
+		if gen.ContainsHash(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rotate drops the oldest generation and appends a new, empty
+// generation compatible with the others.
+func (rf *RollingFilter) Rotate() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	return rf.rotateLocked()
+}
+
+func (rf *RollingFilter) rotateLocked() error {
+	newest := rf.generations[len(rf.generations)-1]
+	fresh, err := newest.NewCompatible()
+	if err != nil {
+		return err
+	}
+	rf.generations = append(rf.generations[1:], fresh)
+	return nil
+}
+
+// RotateAfter starts a goroutine that calls Rotate every d, until Close
+// is called. Calling RotateAfter again replaces the previous ticker.
+func (rf *RollingFilter) RotateAfter(d time.Duration) {
+	rf.lock.Lock()
+	if rf.rotateDone != nil {
+		close(rf.rotateDone)
+	}
+	done := make(chan struct{})
+	rf.rotateDone = done
+	rf.lock.Unlock()
+
+	rf.rotateWG.Add(1)
+	go func() {
+		defer rf.rotateWG.Done()
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rf.Rotate()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the goroutine started by RotateAfter, if any. It is safe
+// to call even if RotateAfter was never called.
+func (rf *RollingFilter) Close() error {
+	rf.lock.Lock()
+	done := rf.rotateDone
+	rf.rotateDone = nil
+	rf.lock.Unlock()
+
+	if done != nil {
+		close(done)
+		rf.rotateWG.Wait()
+	}
+	return nil
+}
+
+// MarshalBinary converts a RollingFilter into []bytes
+// conforms to encoding.BinaryMarshaler
+func (rf *RollingFilter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := rf.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary converts []bytes into a RollingFilter
+// conforms to encoding.BinaryUnmarshaler
+func (rf *RollingFilter) UnmarshalBinary(data []byte) (err error) {
+	buf := bytes.NewBuffer(data)
+	_, err = rf.ReadFrom(buf)
+	return err
+}
+
+// WriteTo a Writer w from a lossless-compressed RollingFilter rf.
+//
+// The format is a small manifest (number of generations, rotateEvery)
+// followed by each generation written oldest-first, back-to-back, using
+// Filter's own binary marshal format, all inside a single gzip stream.
+func (rf *RollingFilter) WriteTo(w io.Writer) (n int64, err error) {
+	rf.lock.RLock()
+	defer rf.lock.RUnlock()
+
+	gzW := gzip.NewWriter(w)
+	defer func() {
+		err = gzW.Close()
+	}()
+
+	if err = binary.Write(gzW, binary.LittleEndian, uint64(len(rf.generations))); err != nil {
+		return n, err
+	}
+	if err = binary.Write(gzW, binary.LittleEndian, rf.rotateEvery); err != nil {
+		return n, err
+	}
+	n += 2 * Uint64Bytes
+
+	for _, gen := range rf.generations {
+		intN, _, err := gen.MarshallToWriter(gzW)
+		n += int64(intN)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom r and overwrite rf with a new RollingFilter
+func (rf *RollingFilter) ReadFrom(r io.Reader) (n int64, err error) {
+	gzR, err := gzip.NewReader(r)
+	if err != nil {
+		return -1, err
+	}
+	defer gzR.Close()
+
+	var numGenerations, rotateEvery uint64
+	if err = binary.Read(gzR, binary.LittleEndian, &numGenerations); err != nil {
+		return -1, err
+	}
+	if err = binary.Read(gzR, binary.LittleEndian, &rotateEvery); err != nil {
+		return -1, err
+	}
+
+	generations := make([]*Filter, numGenerations)
+	for i := uint64(0); i < numGenerations; i++ {
+		gen := new(Filter)
+		if _, err = gen.UnmarshalFromReader(gzR); err != nil {
+			return -1, err
+		}
+		generations[i] = gen
+	}
+
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	rf.generations = generations
+	rf.rotateEvery = rotateEvery
+	return 0, nil
+}
@@ -0,0 +1,76 @@
+package bloomfilter
+
+import "testing"
+
+func TestRollingFilterMarshalBinaryRoundTrip(t *testing.T) {
+	rf, err := NewRolling(3, 1000, 0.01, 10)
+	if err != nil {
+		t.Fatalf("NewRolling: %v", err)
+	}
+	for i := uint64(0); i < 5; i++ {
+		if err := rf.AddHash(i); err != nil {
+			t.Fatalf("AddHash(%d): %v", i, err)
+		}
+	}
+
+	data, err := rf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+
+	loaded := new(RollingFilter)
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	for i := uint64(0); i < 5; i++ {
+		if !loaded.ContainsHash(i) {
+			t.Fatalf("loaded filter missing hash %d", i)
+		}
+	}
+}
+
+func TestRollingFilterRotatesOnCount(t *testing.T) {
+	rf, err := NewRolling(3, 1000, 0.01, 10)
+	if err != nil {
+		t.Fatalf("NewRolling: %v", err)
+	}
+
+	for i := uint64(0); i < 10; i++ {
+		if err := rf.AddHash(i); err != nil {
+			t.Fatalf("AddHash(%d): %v", i, err)
+		}
+	}
+	// The 10th insert should have triggered a rotation, so the generation
+	// that received it is no longer the newest (a fresh, empty one is) and
+	// item 0 should still be reachable through the retained generations.
+	if n := rf.generations[len(rf.generations)-1].n; n != 0 {
+		t.Fatalf("newest generation has n=%d after 10 inserts, want 0 (a rotation)", n)
+	}
+	if !rf.ContainsHash(0) {
+		t.Fatalf("ContainsHash(0) = false, want true before 0 falls out of the window")
+	}
+}
+
+func TestRollingFilterEvictsOldGenerations(t *testing.T) {
+	rf, err := NewRolling(2, 1000, 0.01, 5)
+	if err != nil {
+		t.Fatalf("NewRolling: %v", err)
+	}
+
+	for i := uint64(0); i < 5; i++ {
+		if err := rf.AddHash(i); err != nil {
+			t.Fatalf("AddHash(%d): %v", i, err)
+		}
+	}
+	// Rotating twice more should push the generation holding 0..4 out of
+	// the 2-generation retention window.
+	if err := rf.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if err := rf.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if rf.ContainsHash(0) {
+		t.Fatalf("ContainsHash(0) = true, want false after 0 has fallen out of the retention window")
+	}
+}
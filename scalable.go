@@ -0,0 +1,315 @@
+// Package bloomfilter is face-meltingly fast, thread-safe,
+// marshalable, unionable, probability- and
+// optimal-size-calculating Bloom filter in go
+//
+// https://github.com/steakknife/bloomfilter
+//
+// Copyright © 2014, 2015, 2018 Barry Allard
+//
+// MIT license
+//
+package bloomfilter
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"sync"
+)
+
+// ScalableFilter is a Scalable Bloom Filter, as described by
+// Almeida, Baquero, Preguica and Hutchison, "Scalable Bloom Filters" (2007).
+//
+// It trades the fixed-capacity guarantee of Filter for the ability
+// to keep growing: once the current layer fills up, a new, larger
+// layer is appended with a tighter target false-positive probability,
+// so the compounded false-positive probability across all layers stays
+// bounded as items keep being added.
+type ScalableFilter struct {
+	lock sync.RWMutex
+
+	layers     []*Filter
+	capacities []uint64 // max n for the layer at the same index before it is grown
+
+	n0         uint64
+	p0         float64
+	growth     uint64
+	tightening float64
+	curP       float64 // target false-positive probability of the newest layer
+}
+
+// NewScalable creates a new ScalableFilter.
+//
+// n0 is the capacity of the first layer, p0 is its target false-positive
+// probability. growth is the multiplier applied to the bit-array size of
+// each successive layer (typically 2). tightening is the multiplier
+// applied to the target false-positive probability of each successive
+// layer (typically 0.8), so the compounded false-positive probability
+// converges to p0 / (1 - tightening).
+func NewScalable(n0 uint64, p0 float64, growth uint64, tightening float64) (*ScalableFilter, error) {
+	if n0 < 1 {
+		return nil, fmt.Errorf("n0 must be >= 1 (was %d)", n0)
+	}
+	if p0 <= 0 || p0 >= 1 {
+		return nil, fmt.Errorf("p0 must be in (0, 1) (was %f)", p0)
+	}
+	if growth < 2 {
+		return nil, fmt.Errorf("growth must be >= 2 (was %d)", growth)
+	}
+	if tightening <= 0 || tightening >= 1 {
+		return nil, fmt.Errorf("tightening must be in (0, 1) (was %f)", tightening)
+	}
+
+	f0, err := NewOptimal(n0, p0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScalableFilter{
+		layers:     []*Filter{f0},
+		capacities: []uint64{n0},
+		n0:         n0,
+		p0:         p0,
+		growth:     growth,
+		tightening: tightening,
+		curP:       p0,
+	}, nil
+}
+
+// capacityForMP returns the maxN a Filter with m bits and k chosen by
+// OptimalK would target for a false-positive probability of p. It is the
+// inverse of OptimalM, used to size each new layer's capacity trigger.
+func capacityForMP(m uint64, p float64) uint64 {
+	return uint64(math.Floor(float64(m) * math.Ln2 * math.Ln2 / -math.Log(p)))
+}
+
+// growLayer appends a new layer sized growth*prevM with a target
+// false-positive probability of prevP*tightening. Callers must hold
+// sf.lock for writing.
+func (sf *ScalableFilter) growLayer() error {
+	prev := sf.layers[len(sf.layers)-1]
+	newM := prev.m * sf.growth
+	newP := sf.curP * sf.tightening
+	newCapacity := capacityForMP(newM, newP)
+	newK := OptimalK(newM, newCapacity)
+
+	layer, err := New(newM, newK)
+	if err != nil {
+		return err
+	}
+
+	sf.layers = append(sf.layers, layer)
+	sf.capacities = append(sf.capacities, newCapacity)
+	sf.curP = newP
+	return nil
+}
+
+// Add a hashable item, v, to the filter
+func (sf *ScalableFilter) Add(v hash.Hash64) error {
+	return sf.AddHash(v.Sum64())
+}
+
+// AddHash adds an already-hashed item to the filter.
+// Identical to Add (but slightly faster)
+func (sf *ScalableFilter) AddHash(hash uint64) error {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	last := len(sf.layers) - 1
+	sf.layers[last].AddHash(hash)
+
+	if sf.layers[last].n >= sf.capacities[last] {
+		if err := sf.growLayer(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Contains tests if sf contains v
+// false: sf definitely does not contain value v
+// true:  sf maybe contains value v
+func (sf *ScalableFilter) Contains(v hash.Hash64) bool {
+	return sf.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if sf contains the (already hashed) key
+// Identical to Contains but slightly faster
+func (sf *ScalableFilter) ContainsHash(hash uint64) bool {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+
+	for _, layer := range sf.layers {
+		if layer.ContainsHash(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// NumLayers returns the number of layers currently making up sf
+func (sf *ScalableFilter) NumLayers() int {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	return len(sf.layers)
+}
+
+// sameGeometry reports whether sf and sf2 have the same number of layers,
+// each with matching keys, so they can be unioned layer-by-layer.
+func (sf *ScalableFilter) sameGeometry(sf2 *ScalableFilter) bool {
+	if len(sf.layers) != len(sf2.layers) {
+		return false
+	}
+	for i, layer := range sf.layers {
+		if !layer.IsCompatible(sf2.layers[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Union merges sf and sf2 into a new ScalableFilter out. sf and sf2 must
+// have the same layer geometry (same number of layers, each pairwise
+// compatible: same m and keys). Every layer is created with fresh random
+// keys, so two filters from separate NewScalable calls are never
+// compatible; a filter reloaded with ReadFrom from another's WriteTo
+// output shares its layers' keys and is.
+func (sf *ScalableFilter) Union(sf2 *ScalableFilter) (out *ScalableFilter, err error) {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	sf2.lock.RLock()
+	defer sf2.lock.RUnlock()
+
+	if !sf.sameGeometry(sf2) {
+		return nil, errIncompatibleScalableFilters()
+	}
+
+	out = &ScalableFilter{
+		n0:         sf.n0,
+		p0:         sf.p0,
+		growth:     sf.growth,
+		tightening: sf.tightening,
+		curP:       sf.curP,
+		capacities: append([]uint64(nil), sf.capacities...),
+		layers:     make([]*Filter, len(sf.layers)),
+	}
+	for i, layer := range sf.layers {
+		merged, err := layer.Union(sf2.layers[i])
+		if err != nil {
+			return nil, err
+		}
+		out.layers[i] = merged
+	}
+	return out, nil
+}
+
+func errIncompatibleScalableFilters() error {
+	return fmt.Errorf("incompatible ScalableFilter layer geometries")
+}
+
+// WriteTo a Writer w from a lossless-compressed ScalableFilter sf.
+//
+// The format is a small header (numLayers, n0, p0, growth, tightening)
+// followed by each layer written back-to-back using Filter's own
+// binary marshal format, all inside a single gzip stream.
+func (sf *ScalableFilter) WriteTo(w io.Writer) (n int64, err error) {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+
+	gzW := gzip.NewWriter(w)
+	defer func() {
+		err = gzW.Close()
+	}()
+
+	if err = binary.Write(gzW, binary.LittleEndian, uint64(len(sf.layers))); err != nil {
+		return n, err
+	}
+	if err = binary.Write(gzW, binary.LittleEndian, sf.n0); err != nil {
+		return n, err
+	}
+	if err = binary.Write(gzW, binary.LittleEndian, sf.p0); err != nil {
+		return n, err
+	}
+	if err = binary.Write(gzW, binary.LittleEndian, sf.growth); err != nil {
+		return n, err
+	}
+	if err = binary.Write(gzW, binary.LittleEndian, sf.tightening); err != nil {
+		return n, err
+	}
+	n += int64(8 * 5)
+
+	for _, layer := range sf.layers {
+		intN, _, err := layer.MarshallToWriter(gzW)
+		n += int64(intN)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom r and overwrite sf with a new ScalableFilter
+func (sf *ScalableFilter) ReadFrom(r io.Reader) (n int64, err error) {
+	gzR, err := gzip.NewReader(r)
+	if err != nil {
+		return -1, err
+	}
+	defer gzR.Close()
+
+	var numLayers uint64
+	if err = binary.Read(gzR, binary.LittleEndian, &numLayers); err != nil {
+		return -1, err
+	}
+
+	var n0, growth uint64
+	var p0, tightening float64
+	if err = binary.Read(gzR, binary.LittleEndian, &n0); err != nil {
+		return -1, err
+	}
+	if err = binary.Read(gzR, binary.LittleEndian, &p0); err != nil {
+		return -1, err
+	}
+	if err = binary.Read(gzR, binary.LittleEndian, &growth); err != nil {
+		return -1, err
+	}
+	if err = binary.Read(gzR, binary.LittleEndian, &tightening); err != nil {
+		return -1, err
+	}
+
+	layers := make([]*Filter, numLayers)
+	capacities := make([]uint64, numLayers)
+	curP := p0
+	for i := uint64(0); i < numLayers; i++ {
+		layer := new(Filter)
+		if _, err = layer.UnmarshalFromReader(gzR); err != nil {
+			return -1, err
+		}
+		layers[i] = layer
+		if i == 0 {
+			// The first layer's capacity is the n0 stored in the header,
+			// not a recomputed value: capacityForMP(m, p) is the floor of
+			// OptimalM's inverse, so it can disagree with the n0 that
+			// OptimalM(n0, p0) was actually built from, which would make a
+			// reloaded filter grow at a different insert count than the
+			// original.
+			capacities[i] = n0
+		} else {
+			capacities[i] = capacityForMP(layer.m, curP)
+		}
+		curP *= tightening
+	}
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	sf.layers = layers
+	sf.capacities = capacities
+	sf.n0 = n0
+	sf.p0 = p0
+	sf.growth = growth
+	sf.tightening = tightening
+	sf.curP = curP / tightening
+	return 0, nil
+}
@@ -0,0 +1,56 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScalableFilterGrowsLayers(t *testing.T) {
+	sf, err := NewScalable(8, 0.1, 2, 0.8)
+	if err != nil {
+		t.Fatalf("NewScalable: %v", err)
+	}
+	if sf.NumLayers() != 1 {
+		t.Fatalf("expected 1 layer initially, got %d", sf.NumLayers())
+	}
+
+	for i := uint64(0); i < 100; i++ {
+		if err := sf.AddHash(i); err != nil {
+			t.Fatalf("AddHash(%d): %v", i, err)
+		}
+	}
+	if sf.NumLayers() <= 1 {
+		t.Fatalf("expected more than 1 layer after 100 inserts, got %d", sf.NumLayers())
+	}
+	for i := uint64(0); i < 100; i++ {
+		if !sf.ContainsHash(i) {
+			t.Fatalf("ContainsHash(%d) = false, want true", i)
+		}
+	}
+}
+
+// TestScalableFilterReadFromRestoresCapacity ensures a reloaded
+// ScalableFilter grows its first layer at the same insert count as the
+// original, rather than at a recomputed capacityForMP(m, p0) that can
+// disagree with n0.
+func TestScalableFilterReadFromRestoresCapacity(t *testing.T) {
+	const n0 = 50
+	sf, err := NewScalable(n0, 0.1, 2, 0.8)
+	if err != nil {
+		t.Fatalf("NewScalable: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := sf.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	loaded := new(ScalableFilter)
+	if _, err := loaded.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+
+	if loaded.capacities[0] != n0 {
+		t.Fatalf("loaded.capacities[0] = %d, want %d (the original n0)", loaded.capacities[0], n0)
+	}
+}
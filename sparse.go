@@ -0,0 +1,431 @@
+// Package bloomfilter is face-meltingly fast, thread-safe,
+// marshalable, unionable, probability- and
+// optimal-size-calculating Bloom filter in go
+//
+// https://github.com/steakknife/bloomfilter
+//
+// Copyright © 2014, 2015, 2018 Barry Allard
+//
+// MIT license
+//
+package bloomfilter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/RoaringBitmap/roaring"
+)
+
+const (
+	// densifyThreshold is the density (n set bits / m) above which a
+	// sparse-backed SparseFilter switches to the dense representation.
+	densifyThreshold = 0.05
+	// compactThreshold is the density below which a dense-backed
+	// SparseFilter switches back to the sparse representation.
+	compactThreshold = 0.01
+
+	// sparseFormatFlag and denseFormatFlag tag which bitStore
+	// implementation a serialized SparseFilter uses, so ReadFrom knows
+	// how to decode the body that follows.
+	sparseFormatFlag byte = 0
+	denseFormatFlag  byte = 1
+)
+
+// sparseBitStore is a bitStore backed by a RoaringBitmap, modeled on how
+// search engines like bleve back sparse posting lists. It is far cheaper
+// than denseBitStore when density (n/m) is low, as is common right after
+// a large NewOptimal allocation or in the early layers of a
+// ScalableFilter.
+type sparseBitStore struct {
+	m  uint64
+	rb *roaring.Bitmap
+}
+
+func newSparseBitStore(m uint64) (*sparseBitStore, error) {
+	if m > math.MaxUint32 {
+		return nil, fmt.Errorf("sparse storage supports at most %d bits (m was %d)", uint32(math.MaxUint32), m)
+	}
+	return &sparseBitStore{m: m, rb: roaring.New()}, nil
+}
+
+func (s *sparseBitStore) Set(i uint64) {
+	s.rb.Add(uint32(i))
+}
+
+func (s *sparseBitStore) Test(i uint64) bool {
+	return s.rb.Contains(uint32(i))
+}
+
+func (s *sparseBitStore) Or(o bitStore) error {
+	if o2, ok := o.(*sparseBitStore); ok {
+		s.rb.Or(o2.rb)
+		return nil
+	}
+	for i := uint64(0); i < s.m; i++ {
+		if o.Test(i) {
+			s.Set(i)
+		}
+	}
+	return nil
+}
+
+func (s *sparseBitStore) Len() uint64 {
+	return s.rb.GetCardinality()
+}
+
+func (s *sparseBitStore) SizeInBytes() uint64 {
+	return s.rb.GetSizeInBytes()
+}
+
+func (s *sparseBitStore) Serialize(w io.Writer) (int64, error) {
+	return s.rb.WriteTo(w)
+}
+
+// densify converts s into the equivalent denseBitStore.
+func (s *sparseBitStore) densify() *denseBitStore {
+	d := newDenseBitStore(s.m)
+	s.rb.Iterate(func(x uint32) bool {
+		d.Set(uint64(x))
+		return true
+	})
+	return d
+}
+
+// SparseFilter is a Bloom filter that automatically picks between a
+// dense []uint64 bit-vector and a roaring-bitmap-backed sparse store,
+// so that many small or low-density filters (e.g. shards, or the early
+// layers of a ScalableFilter) can be kept in memory cheaply, while
+// filters that fill up still get the fast dense representation.
+type SparseFilter struct {
+	lock sync.RWMutex
+
+	store bitStore
+	keys  []uint64
+	m     uint64
+	n     uint64
+}
+
+// M is the size of the Bloom filter, in bits
+func (sf *SparseFilter) M() uint64 {
+	return sf.m
+}
+
+// K is the count of keys
+func (sf *SparseFilter) K() uint64 {
+	return uint64(len(sf.keys))
+}
+
+// NewSparse Bloom filter, starting out in the sparse representation,
+// with CSPRNG keys
+func NewSparse(m, k uint64) (*SparseFilter, error) {
+	return NewSparseWithKeys(m, newRandKeys(m, k))
+}
+
+// NewSparseWithKeys creates a new SparseFilter from user-supplied origKeys
+func NewSparseWithKeys(m uint64, origKeys []uint64) (sf *SparseFilter, err error) {
+	store, err := newSparseBitStore(m)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := newKeysCopy(origKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &SparseFilter{
+		store: store,
+		keys:  keys,
+		m:     m,
+	}, nil
+}
+
+// NewCompatible SparseFilter compatible with sf
+func (sf *SparseFilter) NewCompatible() (*SparseFilter, error) {
+	return NewSparseWithKeys(sf.m, sf.keys)
+}
+
+func (sf *SparseFilter) indexesFor(hash uint64) []uint64 {
+	indexes := make([]uint64, len(sf.keys))
+	for n := 0; n < len(sf.keys); n++ {
+		indexes[n] = (hash ^ sf.keys[n]) % sf.m
+	}
+	return indexes
+}
+
+// Add a hashable item, v, to the filter
+func (sf *SparseFilter) Add(v hash.Hash64) {
+	sf.AddHash(v.Sum64())
+}
+
+// AddHash adds an already-hashed item to the filter.
+// Identical to Add (but slightly faster)
+func (sf *SparseFilter) AddHash(hash uint64) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	for _, i := range sf.indexesFor(hash) {
+		sf.store.Set(i)
+	}
+	sf.n++
+	sf.autoSwitch()
+}
+
+// Contains tests if sf contains v
+// false: sf definitely does not contain value v
+// true:  sf maybe contains value v
+func (sf *SparseFilter) Contains(v hash.Hash64) bool {
+	return sf.ContainsHash(v.Sum64())
+}
+
+// ContainsHash tests if sf contains the (already hashed) key
+// Identical to Contains but slightly faster
+func (sf *SparseFilter) ContainsHash(hash uint64) bool {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+
+	for _, i := range sf.indexesFor(hash) {
+		if !sf.store.Test(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// autoSwitch densifies a sparse store once density crosses
+// densifyThreshold, or compacts a dense store once density drops below
+// compactThreshold. Callers must hold sf.lock for writing.
+func (sf *SparseFilter) autoSwitch() {
+	density := float64(sf.store.Len()) / float64(sf.m)
+	switch s := sf.store.(type) {
+	case *sparseBitStore:
+		if density > densifyThreshold {
+			sf.store = s.densify()
+		}
+	case *denseBitStore:
+		if density < compactThreshold {
+			if c, err := s.compact(); err == nil {
+				sf.store = c
+			}
+		}
+	}
+}
+
+// Densify switches sf to the dense representation, regardless of its
+// current density.
+func (sf *SparseFilter) Densify() {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	if s, ok := sf.store.(*sparseBitStore); ok {
+		sf.store = s.densify()
+	}
+}
+
+// Compact switches sf to the sparse representation, regardless of its
+// current density.
+func (sf *SparseFilter) Compact() error {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	if d, ok := sf.store.(*denseBitStore); ok {
+		c, err := d.compact()
+		if err != nil {
+			return err
+		}
+		sf.store = c
+	}
+	return nil
+}
+
+// IsCompatible is true if sf and sf2 are both SparseFilters with the
+// same m and the same keys in the same order
+func (sf *SparseFilter) IsCompatible(sf2 *SparseFilter) bool {
+	if sf.m != sf2.m || len(sf.keys) != len(sf2.keys) {
+		return false
+	}
+	for i, key := range sf.keys {
+		if key != sf2.keys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// UnionInPlace merges SparseFilter sf2 into sf
+func (sf *SparseFilter) UnionInPlace(sf2 *SparseFilter) error {
+	if !sf.IsCompatible(sf2) {
+		return errIncompatibleBloomFilters()
+	}
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	sf2.lock.RLock()
+	defer sf2.lock.RUnlock()
+
+	if err := sf.store.Or(sf2.store); err != nil {
+		return err
+	}
+	sf.n += sf2.n
+	sf.autoSwitch()
+	return nil
+}
+
+// Union merges sf and sf2 into a new SparseFilter out
+func (sf *SparseFilter) Union(sf2 *SparseFilter) (out *SparseFilter, err error) {
+	if !sf.IsCompatible(sf2) {
+		return nil, errIncompatibleBloomFilters()
+	}
+
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	sf2.lock.RLock()
+	defer sf2.lock.RUnlock()
+
+	out, err = sf.NewCompatible()
+	if err != nil {
+		return nil, err
+	}
+	if err = out.store.Or(sf.store); err != nil {
+		return nil, err
+	}
+	if err = out.store.Or(sf2.store); err != nil {
+		return nil, err
+	}
+	out.n = sf.n + sf2.n
+	out.autoSwitch()
+	return out, nil
+}
+
+// candidateBody gzip-compresses the on-wire body (header, keys, store)
+// for the given bitStore, so WriteTo can compare sizes across
+// representations.
+func (sf *SparseFilter) candidateBody(format byte, store bitStore) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	gzW := gzip.NewWriter(&buf)
+
+	if err := binary.Write(gzW, binary.LittleEndian, format); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(gzW, binary.LittleEndian, uint64(len(sf.keys))); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(gzW, binary.LittleEndian, sf.n); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(gzW, binary.LittleEndian, sf.m); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(gzW, binary.LittleEndian, sf.keys); err != nil {
+		return nil, err
+	}
+	if _, err := store.Serialize(gzW); err != nil {
+		return nil, err
+	}
+	if err := gzW.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// WriteTo a Writer w from a lossless-compressed SparseFilter sf. Both
+// the dense and sparse representations of sf's current contents are
+// gzip-compressed and whichever is smaller on the wire is written.
+func (sf *SparseFilter) WriteTo(w io.Writer) (n int64, err error) {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+
+	var dense *denseBitStore
+	var sparse *sparseBitStore
+	switch s := sf.store.(type) {
+	case *denseBitStore:
+		dense = s
+		sparse, _ = s.compact() // m too large for roaring: sparse stays nil, dense-only
+	case *sparseBitStore:
+		sparse = s
+		dense = s.densify()
+	}
+
+	denseBuf, err := sf.candidateBody(denseFormatFlag, dense)
+	if err != nil {
+		return 0, err
+	}
+	best := denseBuf
+
+	if sparse != nil {
+		sparseBuf, err := sf.candidateBody(sparseFormatFlag, sparse)
+		if err != nil {
+			return 0, err
+		}
+		if sparseBuf.Len() < best.Len() {
+			best = sparseBuf
+		}
+	}
+
+	written, err := w.Write(best.Bytes())
+	return int64(written), err
+}
+
+// ReadFrom r and overwrite sf with a new SparseFilter
+func (sf *SparseFilter) ReadFrom(r io.Reader) (n int64, err error) {
+	gzR, err := gzip.NewReader(r)
+	if err != nil {
+		return -1, err
+	}
+	defer gzR.Close()
+
+	var format byte
+	var k, fn, m uint64
+	if err = binary.Read(gzR, binary.LittleEndian, &format); err != nil {
+		return -1, err
+	}
+	if err = binary.Read(gzR, binary.LittleEndian, &k); err != nil {
+		return -1, err
+	}
+	if err = binary.Read(gzR, binary.LittleEndian, &fn); err != nil {
+		return -1, err
+	}
+	if err = binary.Read(gzR, binary.LittleEndian, &m); err != nil {
+		return -1, err
+	}
+	if m < MMin {
+		return -1, errM()
+	}
+	keys := make([]uint64, k)
+	if err = binary.Read(gzR, binary.LittleEndian, keys); err != nil {
+		return -1, err
+	}
+
+	var store bitStore
+	switch format {
+	case denseFormatFlag:
+		d := newDenseBitStore(m)
+		if err = binary.Read(gzR, binary.LittleEndian, d.bits); err != nil {
+			return -1, err
+		}
+		d.recount()
+		store = d
+	case sparseFormatFlag:
+		s, err := newSparseBitStore(m)
+		if err != nil {
+			return -1, err
+		}
+		if _, err = s.rb.ReadFrom(gzR); err != nil {
+			return -1, err
+		}
+		store = s
+	default:
+		return -1, fmt.Errorf("unknown SparseFilter storage format %d", format)
+	}
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	sf.store = store
+	sf.keys = keys
+	sf.m = m
+	sf.n = fn
+	return 0, nil
+}
@@ -0,0 +1,99 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSparseFilterDensifiesAboveThreshold(t *testing.T) {
+	sf, err := NewSparse(1000, 3)
+	if err != nil {
+		t.Fatalf("NewSparse: %v", err)
+	}
+	if _, ok := sf.store.(*sparseBitStore); !ok {
+		t.Fatalf("new SparseFilter should start in the sparse representation")
+	}
+
+	for i := uint64(0); i < 200; i++ {
+		sf.AddHash(i)
+	}
+	if _, ok := sf.store.(*denseBitStore); !ok {
+		t.Fatalf("SparseFilter should have densified past densifyThreshold, still %T", sf.store)
+	}
+}
+
+func TestSparseFilterCompactRoundTrip(t *testing.T) {
+	sf, err := NewSparse(1000, 3)
+	if err != nil {
+		t.Fatalf("NewSparse: %v", err)
+	}
+	for i := uint64(0); i < 5; i++ {
+		sf.AddHash(i)
+	}
+
+	sf.Densify()
+	if _, ok := sf.store.(*denseBitStore); !ok {
+		t.Fatalf("Densify should switch to denseBitStore")
+	}
+	for i := uint64(0); i < 5; i++ {
+		if !sf.ContainsHash(i) {
+			t.Fatalf("ContainsHash(%d) = false after Densify", i)
+		}
+	}
+
+	if err := sf.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if _, ok := sf.store.(*sparseBitStore); !ok {
+		t.Fatalf("Compact should switch back to sparseBitStore")
+	}
+	for i := uint64(0); i < 5; i++ {
+		if !sf.ContainsHash(i) {
+			t.Fatalf("ContainsHash(%d) = false after Compact", i)
+		}
+	}
+}
+
+// TestDenseBitStoreLenIsIncremental checks that the incrementally tracked
+// Len (autoSwitch calls it on every AddHash) counts each set bit once and
+// agrees with a true popcount.
+func TestDenseBitStoreLenIsIncremental(t *testing.T) {
+	d := newDenseBitStore(1000)
+	if d.Len() != 0 {
+		t.Fatalf("Len() = %d on an empty store, want 0", d.Len())
+	}
+	d.Set(5)
+	d.Set(5) // setting the same bit twice must not double-count
+	d.Set(500)
+	if d.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", d.Len())
+	}
+	if got, want := d.Len(), d.countSetBits(); got != want {
+		t.Fatalf("Len() = %d disagrees with a true popcount of %d", got, want)
+	}
+}
+
+func TestSparseFilterWriteToReadFromRoundTrip(t *testing.T) {
+	sf, err := NewSparse(1000, 3)
+	if err != nil {
+		t.Fatalf("NewSparse: %v", err)
+	}
+	for i := uint64(0); i < 5; i++ {
+		sf.AddHash(i)
+	}
+
+	var buf bytes.Buffer
+	if _, err := sf.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	loaded := new(SparseFilter)
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	for i := uint64(0); i < 5; i++ {
+		if !loaded.ContainsHash(i) {
+			t.Fatalf("loaded filter missing hash %d", i)
+		}
+	}
+}